@@ -0,0 +1,2129 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package sfnt implements a decoder for SFNT font file formats, including
+// TrueType and OpenType.
+package sfnt // import "golang.org/x/image/font/sfnt"
+
+// This implementation is written against the OpenType v1.8.3 spec:
+// https://www.microsoft.com/typography/otspec/otff.htm
+//
+// The CFF glyph data format is also used, as described at:
+// https://www.adobe.com/content/dam/acom/en/devnet/font/pdfs/5176.CFF.pdf
+// https://www.adobe.com/content/dam/acom/en/devnet/font/pdfs/5177.Type2.pdf
+
+import (
+	"errors"
+	"io"
+	"math"
+	"strconv"
+
+	"golang.org/x/image/math/fixed"
+)
+
+// ErrNotFound indicates that a requested table or value is not present in
+// the font.
+var ErrNotFound = errors.New("sfnt: not found")
+
+var (
+	errInvalidBounds     = errors.New("sfnt: invalid bounds")
+	errInvalidCFFTable   = errors.New("sfnt: invalid CFF table")
+	errInvalidCmapTable  = errors.New("sfnt: invalid cmap table")
+	errInvalidFont       = errors.New("sfnt: invalid font")
+	errInvalidGlyphData  = errors.New("sfnt: invalid glyph data")
+	errInvalidGlyphIndex = errors.New("sfnt: invalid glyph index")
+	errInvalidGPOSTable  = errors.New("sfnt: invalid GPOS table")
+	errInvalidHeadTable  = errors.New("sfnt: invalid head table")
+	errInvalidHheaTable  = errors.New("sfnt: invalid hhea table")
+	errInvalidHmtxTable  = errors.New("sfnt: invalid hmtx table")
+	errInvalidKernTable  = errors.New("sfnt: invalid kern table")
+	errInvalidLocaTable  = errors.New("sfnt: invalid loca table")
+	errInvalidMaxpTable  = errors.New("sfnt: invalid maxp table")
+	errInvalidPostTable  = errors.New("sfnt: invalid post table")
+	errInvalidSourceData = errors.New("sfnt: invalid source data")
+
+	errUnsupportedCFFVersion      = errors.New("sfnt: unsupported CFF version")
+	errUnsupportedCmapFormat      = errors.New("sfnt: unsupported cmap format")
+	errUnsupportedCompoundGlyph   = errors.New("sfnt: unsupported compound glyph")
+	errUnsupportedGlyphDataLength = errors.New("sfnt: unsupported glyph data length")
+	errUnsupportedGlyphFormat     = errors.New("sfnt: unsupported glyph format")
+	errUnsupportedNumberOfTables  = errors.New("sfnt: unsupported number of tables")
+	errUnsupportedPairPosFormat   = errors.New("sfnt: unsupported GPOS PairPos format")
+)
+
+const maxNumTables = 64
+
+// Units are an integral number of abstract, scalable "font units". The
+// conversion factor from units to pixels is the font's units-per-em (UPEM)
+// value together with the requested pixels-per-em (PPEM).
+type Units int32
+
+// GlyphIndex is a glyph index in a Font.
+type GlyphIndex uint16
+
+// Hinting selects how, if at all, to hint glyph outlines. Hinting is not yet
+// implemented; every value currently behaves the same as NoHinting.
+type Hinting int
+
+const (
+	NoHinting Hinting = iota
+	VerticalHinting
+	FullHinting
+)
+
+// LoadGlyphOptions are the options to the Font.LoadGlyph method.
+type LoadGlyphOptions struct {
+	// Hinting selects how to hint the glyph outline. The zero value means
+	// no hinting.
+	Hinting Hinting
+}
+
+// SegmentOp is a Segment's operation.
+type SegmentOp uint32
+
+const (
+	SegmentOpMoveTo SegmentOp = iota
+	SegmentOpLineTo
+	SegmentOpQuadTo
+	SegmentOpCubeTo
+)
+
+// Segment is a segment of a glyph's outline, as returned by Font.LoadGlyph.
+//
+// The Args are scaled to the Font.LoadGlyph ppem argument: an unscaled (ppem
+// == 0) MoveTo, LineTo, QuadTo or CubeTo's Args hold integer font units, converted
+// directly to fixed.Int26_6, while a scaled (ppem != 0) Segment's Args hold
+// pixels.
+type Segment struct {
+	Op   SegmentOp
+	Args [6]fixed.Int26_6
+}
+
+// source is the underlying data for a Font: either a []byte in memory, or an
+// io.ReaderAt for larger fonts that shouldn't be read in their entirety up
+// front.
+type source struct {
+	b []byte
+	r io.ReaderAt
+}
+
+// view returns the length bytes at the given offset. When the source is
+// backed by an io.ReaderAt, the bytes are read into buf.buf (which is grown
+// as necessary), so that repeated calls for short-lived data (such as table
+// directory entries) don't allocate over and over again. Callers that need
+// the returned slice to outlive a subsequent view call (for example, a CFF
+// charstring that will recurse into its own subroutines) must copy it.
+func (s *source) view(buf *Buffer, offset, length int) ([]byte, error) {
+	if offset < 0 || length < 0 {
+		return nil, errInvalidBounds
+	}
+	if s.b != nil {
+		if len(s.b)-offset < length {
+			return nil, errInvalidBounds
+		}
+		return s.b[offset : offset+length : offset+length], nil
+	}
+	if cap(buf.buf) < length {
+		buf.buf = make([]byte, length)
+	}
+	b := buf.buf[:length]
+	if n, err := s.r.ReadAt(b, int64(offset)); n != length {
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		return nil, errInvalidSourceData
+	}
+	return b, nil
+}
+
+// Buffer holds re-usable buffers that can reduce the total number of
+// allocations when calling multiple Font methods for the same Font.
+//
+// It is not safe for concurrent use.
+type Buffer struct {
+	buf      []byte
+	Segments []Segment
+
+	// compositeDepth is the current recursion depth of nested composite
+	// glyph components, used to guard against cyclic references.
+	compositeDepth int
+}
+
+type tableRecord struct {
+	offset, length uint32
+}
+
+func (t tableRecord) isZero() bool { return t.offset == 0 && t.length == 0 }
+
+// Font is an SFNT font, such as TrueType or OpenType.
+type Font struct {
+	src source
+
+	head, maxp, cff, loca, glyf, post, cmap tableRecord
+	hhea, hmtx, kern, gpos                  tableRecord
+
+	unitsPerEm Units
+	numGlyphs  int
+
+	locaLong bool // whether the loca table uses the long (uint32) format
+
+	// numberOfHMetrics is the hhea table's count of explicit hmtx entries;
+	// glyph indices at or beyond it re-use the final entry's AdvanceWidth.
+	numberOfHMetrics int
+
+	cffGlobalSubrs, cffLocalSubrs, cffCharStrings cffIndex
+	cffDefaultWidthX, cffNominalWidthX            float64
+}
+
+// NumGlyphs returns the number of glyphs in f.
+func (f *Font) NumGlyphs() int { return f.numGlyphs }
+
+// UnitsPerEm returns the number of units per em for f.
+func (f *Font) UnitsPerEm() Units { return f.unitsPerEm }
+
+// Parse parses an in-memory SFNT font, such as TrueType or OpenType data.
+//
+// The returned Font's methods should only be called with a Buffer that is
+// used for a series of calls to that Font, not used concurrently for calls
+// to two or more Fonts.
+func Parse(src []byte) (*Font, error) {
+	return parse(&source{b: src})
+}
+
+// ParseReaderAt parses an SFNT font from r.
+func ParseReaderAt(r io.ReaderAt) (*Font, error) {
+	return parse(&source{r: r})
+}
+
+func u16(b []byte) uint16 { return uint16(b[0])<<8 | uint16(b[1]) }
+func u32(b []byte) uint32 {
+	return uint32(b[0])<<24 | uint32(b[1])<<16 | uint32(b[2])<<8 | uint32(b[3])
+}
+
+func loadTag(s string) uint32 {
+	return uint32(s[0])<<24 | uint32(s[1])<<16 | uint32(s[2])<<8 | uint32(s[3])
+}
+
+var (
+	tagCFF  = loadTag("CFF ")
+	tagCmap = loadTag("cmap")
+	tagGlyf = loadTag("glyf")
+	tagGPOS = loadTag("GPOS")
+	tagHead = loadTag("head")
+	tagHhea = loadTag("hhea")
+	tagHmtx = loadTag("hmtx")
+	tagKern = loadTag("kern")
+	tagLoca = loadTag("loca")
+	tagMaxp = loadTag("maxp")
+	tagPost = loadTag("post")
+)
+
+func parse(src *source) (*Font, error) {
+	var buf Buffer
+
+	header, err := src.view(&buf, 0, 12)
+	if err != nil {
+		return nil, err
+	}
+	numTables := int(u16(header[4:]))
+	if numTables > maxNumTables {
+		return nil, errUnsupportedNumberOfTables
+	}
+
+	records, err := src.view(&buf, 12, 16*numTables)
+	if err != nil {
+		return nil, err
+	}
+
+	f := &Font{src: *src}
+	for i := 0; i < numTables; i++ {
+		rec := records[16*i:]
+		tag := u32(rec)
+		tr := tableRecord{offset: u32(rec[8:]), length: u32(rec[12:])}
+		switch tag {
+		case tagHead:
+			f.head = tr
+		case tagMaxp:
+			f.maxp = tr
+		case tagCFF:
+			f.cff = tr
+		case tagLoca:
+			f.loca = tr
+		case tagGlyf:
+			f.glyf = tr
+		case tagPost:
+			f.post = tr
+		case tagCmap:
+			f.cmap = tr
+		case tagHhea:
+			f.hhea = tr
+		case tagHmtx:
+			f.hmtx = tr
+		case tagKern:
+			f.kern = tr
+		case tagGPOS:
+			f.gpos = tr
+		}
+	}
+
+	if err := f.parseHead(&buf); err != nil {
+		return nil, err
+	}
+	if err := f.parseMaxp(&buf); err != nil {
+		return nil, err
+	}
+	if !f.cff.isZero() {
+		if err := f.parseCFF(&buf); err != nil {
+			return nil, err
+		}
+	}
+	if !f.hhea.isZero() {
+		if err := f.parseHhea(&buf); err != nil {
+			return nil, err
+		}
+	}
+	return f, nil
+}
+
+func (f *Font) parseHead(buf *Buffer) error {
+	if f.head.isZero() {
+		return errInvalidHeadTable
+	}
+	data, err := f.src.view(buf, int(f.head.offset), 54)
+	if err != nil {
+		return err
+	}
+	f.unitsPerEm = Units(u16(data[18:]))
+	if f.unitsPerEm == 0 {
+		return errInvalidHeadTable
+	}
+	f.locaLong = int16(u16(data[50:])) != 0
+	return nil
+}
+
+func (f *Font) parseMaxp(buf *Buffer) error {
+	if f.maxp.isZero() {
+		return errInvalidMaxpTable
+	}
+	data, err := f.src.view(buf, int(f.maxp.offset), 6)
+	if err != nil {
+		return err
+	}
+	f.numGlyphs = int(u16(data[4:]))
+	return nil
+}
+
+func (f *Font) parseHhea(buf *Buffer) error {
+	data, err := f.src.view(buf, int(f.hhea.offset), 36)
+	if err != nil {
+		return err
+	}
+	f.numberOfHMetrics = int(u16(data[34:]))
+	if f.numberOfHMetrics == 0 || f.numberOfHMetrics > f.numGlyphs {
+		return errInvalidHheaTable
+	}
+	return nil
+}
+
+// ---------------------------------------------------------------------
+// CFF ("Compact Font Format") parsing.
+// ---------------------------------------------------------------------
+
+// cffIndex is a CFF INDEX structure, lazily resolved against the Font's
+// source: offsets holds len+1 (1-based) entries (the last marks the end of
+// the final entry) and base is added to them, so that entry i spans
+// [base+offsets[i], base+offsets[i+1]). base is relative to the CFF table
+// until makeAbsolute turns it into a file offset.
+type cffIndex struct {
+	offsets []uint32
+	base    uint32
+}
+
+func (x cffIndex) len() int { return len(x.offsets) - 1 }
+
+func (x cffIndex) get(i int) (start, end uint32) {
+	return x.base + x.offsets[i], x.base + x.offsets[i+1]
+}
+
+func (x cffIndex) makeAbsolute(tableOffset uint32) cffIndex {
+	return cffIndex{offsets: x.offsets, base: x.base + tableOffset}
+}
+
+func readCFFOffset(b []byte, offSize int) uint32 {
+	var v uint32
+	for i := 0; i < offSize; i++ {
+		v = v<<8 | uint32(b[i])
+	}
+	return v
+}
+
+// parseCFFIndex parses a CFF INDEX starting at data[pos:], returning the
+// index and the position immediately following it.
+func parseCFFIndex(data []byte, pos int) (cffIndex, int, error) {
+	if pos+2 > len(data) {
+		return cffIndex{}, 0, errInvalidCFFTable
+	}
+	count := int(u16(data[pos:]))
+	if count == 0 {
+		return cffIndex{}, pos + 2, nil
+	}
+	if pos+3 > len(data) {
+		return cffIndex{}, 0, errInvalidCFFTable
+	}
+	offSize := int(data[pos+2])
+	if offSize < 1 || offSize > 4 {
+		return cffIndex{}, 0, errInvalidCFFTable
+	}
+	arrayStart := pos + 3
+	arrayLen := (count + 1) * offSize
+	if arrayStart+arrayLen > len(data) {
+		return cffIndex{}, 0, errInvalidCFFTable
+	}
+	offsets := make([]uint32, count+1)
+	for i := range offsets {
+		offsets[i] = readCFFOffset(data[arrayStart+i*offSize:], offSize)
+		if i > 0 && offsets[i] < offsets[i-1] {
+			// Offsets must be non-decreasing: every entry's (start, end) is
+			// later computed as (offsets[i], offsets[i+1]), and a decrease
+			// would yield start > end.
+			return cffIndex{}, 0, errInvalidCFFTable
+		}
+	}
+	// Offsets are 1-based, relative to the byte following the offset array.
+	dataStart := arrayStart + arrayLen - 1
+	end := dataStart + int(offsets[count])
+	if end > len(data) {
+		return cffIndex{}, 0, errInvalidCFFTable
+	}
+	return cffIndex{offsets: offsets, base: uint32(dataStart)}, end, nil
+}
+
+// cffDict is a parsed CFF DICT: a map from (possibly escaped) operator to
+// its operand(s). Two-byte operators (12 N) are keyed as 1200+N.
+type cffDict map[int][]float64
+
+func (d cffDict) intValue(op int) (int, bool) {
+	v, ok := d[op]
+	if !ok || len(v) == 0 {
+		return 0, false
+	}
+	return int(v[0]), true
+}
+
+func (d cffDict) numValue(op int) (float64, bool) {
+	v, ok := d[op]
+	if !ok || len(v) == 0 {
+		return 0, false
+	}
+	return v[0], true
+}
+
+func (d cffDict) pairValue(op int) (a, b int, ok bool) {
+	v, ok := d[op]
+	if !ok || len(v) < 2 {
+		return 0, 0, false
+	}
+	return int(v[0]), int(v[1]), true
+}
+
+func parseCFFDict(data []byte) (cffDict, error) {
+	d := cffDict{}
+	var operands []float64
+	for i := 0; i < len(data); {
+		b0 := data[i]
+		switch {
+		case b0 <= 21:
+			op := int(b0)
+			i++
+			if op == 12 {
+				if i >= len(data) {
+					return nil, errInvalidCFFTable
+				}
+				op = 1200 + int(data[i])
+				i++
+			}
+			d[op] = operands
+			operands = nil
+		case b0 == 28:
+			if i+3 > len(data) {
+				return nil, errInvalidCFFTable
+			}
+			v := int16(u16(data[i+1:]))
+			operands = append(operands, float64(v))
+			i += 3
+		case b0 == 29:
+			if i+5 > len(data) {
+				return nil, errInvalidCFFTable
+			}
+			v := int32(u32(data[i+1:]))
+			operands = append(operands, float64(v))
+			i += 5
+		case b0 == 30:
+			// Real number, encoded as a sequence of nibbles.
+			i++
+			s := make([]byte, 0, 16)
+			const nibbles = "0123456789.EE?-?"
+		nibbleLoop:
+			for i < len(data) {
+				b := data[i]
+				i++
+				for _, nib := range [2]byte{b >> 4, b & 0xf} {
+					switch nib {
+					case 0xf:
+						break nibbleLoop
+					case 0xc:
+						s = append(s, 'E', '-')
+					default:
+						s = append(s, nibbles[nib])
+					}
+				}
+			}
+			v, err := parseCFFReal(string(s))
+			if err != nil {
+				return nil, err
+			}
+			operands = append(operands, v)
+		case b0 >= 32 && b0 <= 246:
+			operands = append(operands, float64(int(b0)-139))
+			i++
+		case b0 >= 247 && b0 <= 250:
+			if i+2 > len(data) {
+				return nil, errInvalidCFFTable
+			}
+			operands = append(operands, float64((int(b0)-247)*256+int(data[i+1])+108))
+			i += 2
+		case b0 >= 251 && b0 <= 254:
+			if i+2 > len(data) {
+				return nil, errInvalidCFFTable
+			}
+			operands = append(operands, float64(-(int(b0)-251)*256-int(data[i+1])-108))
+			i += 2
+		default:
+			return nil, errInvalidCFFTable
+		}
+	}
+	return d, nil
+}
+
+func parseCFFReal(s string) (float64, error) {
+	if s == "" {
+		return 0, nil
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, errInvalidCFFTable
+	}
+	return v, nil
+}
+
+func (f *Font) parseCFF(buf *Buffer) error {
+	data, err := f.src.view(buf, int(f.cff.offset), int(f.cff.length))
+	if err != nil {
+		return err
+	}
+	if len(data) < 4 {
+		return errInvalidCFFTable
+	}
+	if data[0] != 1 {
+		return errUnsupportedCFFVersion
+	}
+	pos := int(data[2]) // hdrSize
+	if pos > len(data) {
+		return errInvalidCFFTable
+	}
+
+	// Name INDEX.
+	_, pos, err = parseCFFIndex(data, pos)
+	if err != nil {
+		return err
+	}
+	// Top DICT INDEX.
+	topIdx, pos, err := parseCFFIndex(data, pos)
+	if err != nil {
+		return err
+	}
+	if topIdx.len() != 1 {
+		// CID-keyed / FontSet CFF data isn't supported.
+		return errUnsupportedCFFVersion
+	}
+	// String INDEX.
+	_, pos, err = parseCFFIndex(data, pos)
+	if err != nil {
+		return err
+	}
+	// Global Subr INDEX.
+	gsubrIdx, _, err := parseCFFIndex(data, pos)
+	if err != nil {
+		return err
+	}
+	f.cffGlobalSubrs = gsubrIdx.makeAbsolute(f.cff.offset)
+
+	s, e := topIdx.get(0)
+	if e > uint32(len(data)) {
+		return errInvalidCFFTable
+	}
+	topDict, err := parseCFFDict(data[s:e])
+	if err != nil {
+		return err
+	}
+	charStringsOff, ok := topDict.intValue(17)
+	if !ok || charStringsOff < 0 || charStringsOff > len(data) {
+		return errInvalidCFFTable
+	}
+	csIdx, _, err := parseCFFIndex(data, charStringsOff)
+	if err != nil {
+		return err
+	}
+	f.cffCharStrings = csIdx.makeAbsolute(f.cff.offset)
+
+	if privSize, privOff, ok := topDict.pairValue(18); ok {
+		if privOff < 0 || privSize < 0 || privOff+privSize > len(data) {
+			return errInvalidCFFTable
+		}
+		privDict, err := parseCFFDict(data[privOff : privOff+privSize])
+		if err != nil {
+			return err
+		}
+		if dw, ok := privDict.numValue(20); ok {
+			f.cffDefaultWidthX = dw
+		}
+		if nw, ok := privDict.numValue(21); ok {
+			f.cffNominalWidthX = nw
+		}
+		if subrsOff, ok := privDict.intValue(19); ok {
+			if privOff+subrsOff > len(data) {
+				return errInvalidCFFTable
+			}
+			lsubrIdx, _, err := parseCFFIndex(data, privOff+subrsOff)
+			if err != nil {
+				return err
+			}
+			f.cffLocalSubrs = lsubrIdx.makeAbsolute(f.cff.offset)
+		}
+	}
+	return nil
+}
+
+func cffBias(n int) int32 {
+	switch {
+	case n < 1240:
+		return 107
+	case n < 33900:
+		return 1131
+	default:
+		return 32768
+	}
+}
+
+const maxCFFSubrDepth = 10
+
+// cffInterp interprets a Type 2 charstring, appending the resulting
+// MoveTo/LineTo/CubeTo segments to b.Segments.
+type cffInterp struct {
+	f          *Font
+	b          *Buffer
+	ppem       fixed.Int26_6
+	unitsPerEm Units
+
+	globalBias, localBias int32
+
+	stack     []float64
+	x, y      float64
+	nStems    int
+	haveWidth bool
+	depth     int
+}
+
+// scaleFontUnits converts a coordinate in font design units to a
+// fixed.Int26_6. A ppem of zero leaves v unscaled (the LoadGlyph "unscaled"
+// mode); otherwise v is scaled by ppem/unitsPerEm into pixel space.
+func scaleFontUnits(v float64, unitsPerEm Units, ppem fixed.Int26_6) fixed.Int26_6 {
+	if ppem == 0 {
+		return fixed.Int26_6(math.Round(v)) << 6
+	}
+	return fixed.Int26_6(math.Round(v * float64(ppem) / float64(unitsPerEm)))
+}
+
+func (p *cffInterp) scale(v float64) fixed.Int26_6 {
+	return scaleFontUnits(v, p.unitsPerEm, p.ppem)
+}
+
+func (p *cffInterp) moveTo(dx, dy float64) {
+	p.x += dx
+	p.y += dy
+	p.b.Segments = append(p.b.Segments, Segment{
+		Op: SegmentOpMoveTo,
+		Args: [6]fixed.Int26_6{
+			0: p.scale(p.x),
+			1: p.scale(p.y),
+		},
+	})
+}
+
+func (p *cffInterp) lineTo(dx, dy float64) {
+	p.x += dx
+	p.y += dy
+	p.b.Segments = append(p.b.Segments, Segment{
+		Op: SegmentOpLineTo,
+		Args: [6]fixed.Int26_6{
+			0: p.scale(p.x),
+			1: p.scale(p.y),
+		},
+	})
+}
+
+func (p *cffInterp) curveTo(dxa, dya, dxb, dyb, dxc, dyc float64) {
+	xa := p.x + dxa
+	ya := p.y + dya
+	xb := xa + dxb
+	yb := ya + dyb
+	xc := xb + dxc
+	yc := yb + dyc
+	p.x, p.y = xc, yc
+	p.b.Segments = append(p.b.Segments, Segment{
+		Op: SegmentOpCubeTo,
+		Args: [6]fixed.Int26_6{
+			0: p.scale(xa), 1: p.scale(ya),
+			2: p.scale(xb), 3: p.scale(yb),
+			4: p.scale(xc), 5: p.scale(yc),
+		},
+	})
+}
+
+// takeWidth removes a leading width argument from the stack, if present.
+// nArgs is the number of arguments the operator expects; a negative nArgs
+// means the operator expects an even number of arguments (the stem hints).
+func (p *cffInterp) takeWidth(nArgs int) {
+	if p.haveWidth {
+		return
+	}
+	p.haveWidth = true
+	extra := false
+	if nArgs < 0 {
+		extra = len(p.stack)%2 == 1
+	} else {
+		extra = len(p.stack) > nArgs
+	}
+	if extra {
+		p.stack = p.stack[1:]
+	}
+}
+
+func (p *cffInterp) subr(idx cffIndex, n int32, bias int32) ([]byte, error) {
+	i := int(n + bias)
+	if i < 0 || i >= idx.len() {
+		return nil, errInvalidCFFTable
+	}
+	s, e := idx.get(i)
+	data, err := p.f.src.view(p.b, int(s), int(e-s))
+	if err != nil {
+		return nil, err
+	}
+	// The subroutine may itself call subroutines, which could invalidate
+	// p.b.buf (the scratch space view reuses); take an owned copy.
+	return append([]byte(nil), data...), nil
+}
+
+func (p *cffInterp) run(data []byte) error {
+	p.depth++
+	if p.depth > maxCFFSubrDepth {
+		return errInvalidCFFTable
+	}
+	defer func() { p.depth-- }()
+
+	for i := 0; i < len(data); {
+		b0 := data[i]
+		switch {
+		case b0 == 28:
+			if i+3 > len(data) {
+				return errInvalidCFFTable
+			}
+			p.stack = append(p.stack, float64(int16(u16(data[i+1:]))))
+			i += 3
+			continue
+		case b0 == 255:
+			if i+5 > len(data) {
+				return errInvalidCFFTable
+			}
+			p.stack = append(p.stack, float64(int32(u32(data[i+1:])))/65536)
+			i += 5
+			continue
+		case b0 >= 32 && b0 <= 246:
+			p.stack = append(p.stack, float64(int(b0)-139))
+			i++
+			continue
+		case b0 >= 247 && b0 <= 250:
+			if i+2 > len(data) {
+				return errInvalidCFFTable
+			}
+			p.stack = append(p.stack, float64((int(b0)-247)*256+int(data[i+1])+108))
+			i += 2
+			continue
+		case b0 >= 251 && b0 <= 254:
+			if i+2 > len(data) {
+				return errInvalidCFFTable
+			}
+			p.stack = append(p.stack, float64(-(int(b0)-251)*256-int(data[i+1])-108))
+			i += 2
+			continue
+		}
+
+		i++
+		op := int(b0)
+		if op == 12 {
+			if i >= len(data) {
+				return errInvalidCFFTable
+			}
+			op = 1200 + int(data[i])
+			i++
+		}
+
+		switch op {
+		case 1, 3, 18, 23: // hstem, vstem, hstemhm, vstemhm
+			p.takeWidth(-1)
+			p.nStems += len(p.stack) / 2
+			p.stack = p.stack[:0]
+
+		case 19, 20: // hintmask, cntrmask
+			p.takeWidth(-1)
+			p.nStems += len(p.stack) / 2
+			p.stack = p.stack[:0]
+			i += (p.nStems + 7) / 8
+
+		case 21: // rmoveto
+			p.takeWidth(2)
+			if len(p.stack) < 2 {
+				return errInvalidCFFTable
+			}
+			p.moveTo(p.stack[0], p.stack[1])
+			p.stack = p.stack[:0]
+
+		case 22: // hmoveto
+			p.takeWidth(1)
+			if len(p.stack) < 1 {
+				return errInvalidCFFTable
+			}
+			p.moveTo(p.stack[0], 0)
+			p.stack = p.stack[:0]
+
+		case 4: // vmoveto
+			p.takeWidth(1)
+			if len(p.stack) < 1 {
+				return errInvalidCFFTable
+			}
+			p.moveTo(0, p.stack[0])
+			p.stack = p.stack[:0]
+
+		case 5: // rlineto
+			for j := 0; j+1 < len(p.stack); j += 2 {
+				p.lineTo(p.stack[j], p.stack[j+1])
+			}
+			p.stack = p.stack[:0]
+
+		case 6, 7: // hlineto, vlineto
+			horiz := op == 6
+			for _, v := range p.stack {
+				if horiz {
+					p.lineTo(v, 0)
+				} else {
+					p.lineTo(0, v)
+				}
+				horiz = !horiz
+			}
+			p.stack = p.stack[:0]
+
+		case 8: // rrcurveto
+			for j := 0; j+5 < len(p.stack); j += 6 {
+				p.curveTo(p.stack[j], p.stack[j+1], p.stack[j+2], p.stack[j+3], p.stack[j+4], p.stack[j+5])
+			}
+			p.stack = p.stack[:0]
+
+		case 24: // rcurveline
+			j := 0
+			for ; j+5 < len(p.stack)-2; j += 6 {
+				p.curveTo(p.stack[j], p.stack[j+1], p.stack[j+2], p.stack[j+3], p.stack[j+4], p.stack[j+5])
+			}
+			if j+1 < len(p.stack) {
+				p.lineTo(p.stack[j], p.stack[j+1])
+			}
+			p.stack = p.stack[:0]
+
+		case 25: // rlinecurve
+			j := 0
+			for ; j+1 < len(p.stack)-6; j += 2 {
+				p.lineTo(p.stack[j], p.stack[j+1])
+			}
+			if j+5 < len(p.stack) {
+				p.curveTo(p.stack[j], p.stack[j+1], p.stack[j+2], p.stack[j+3], p.stack[j+4], p.stack[j+5])
+			}
+			p.stack = p.stack[:0]
+
+		case 26: // vvcurveto
+			j, dx1 := 0, 0.0
+			if len(p.stack)%4 == 1 {
+				dx1 = p.stack[0]
+				j = 1
+			}
+			for ; j+3 < len(p.stack); j += 4 {
+				p.curveTo(dx1, p.stack[j], p.stack[j+1], p.stack[j+2], 0, p.stack[j+3])
+				dx1 = 0
+			}
+			p.stack = p.stack[:0]
+
+		case 27: // hhcurveto
+			j, dy1 := 0, 0.0
+			if len(p.stack)%4 == 1 {
+				dy1 = p.stack[0]
+				j = 1
+			}
+			for ; j+3 < len(p.stack); j += 4 {
+				p.curveTo(p.stack[j], dy1, p.stack[j+1], p.stack[j+2], p.stack[j+3], 0)
+				dy1 = 0
+			}
+			p.stack = p.stack[:0]
+
+		case 30, 31: // vhcurveto, hvcurveto
+			horiz := op == 31
+			j := 0
+			for ; j+3 < len(p.stack); j += 4 {
+				last := j+4 == len(p.stack)-1
+				var extra float64
+				if last {
+					extra = p.stack[j+4]
+				}
+				if horiz {
+					p.curveTo(p.stack[j], 0, p.stack[j+1], p.stack[j+2], extra, p.stack[j+3])
+				} else {
+					p.curveTo(0, p.stack[j], p.stack[j+1], p.stack[j+2], p.stack[j+3], extra)
+				}
+				horiz = !horiz
+			}
+			p.stack = p.stack[:0]
+
+		case 10: // callsubr
+			if len(p.stack) < 1 {
+				return errInvalidCFFTable
+			}
+			n := p.stack[len(p.stack)-1]
+			p.stack = p.stack[:len(p.stack)-1]
+			sub, err := p.subr(p.f.cffLocalSubrs, int32(n), p.localBias)
+			if err != nil {
+				return err
+			}
+			if err := p.run(sub); err != nil {
+				return err
+			}
+
+		case 29: // callgsubr
+			if len(p.stack) < 1 {
+				return errInvalidCFFTable
+			}
+			n := p.stack[len(p.stack)-1]
+			p.stack = p.stack[:len(p.stack)-1]
+			sub, err := p.subr(p.f.cffGlobalSubrs, int32(n), p.globalBias)
+			if err != nil {
+				return err
+			}
+			if err := p.run(sub); err != nil {
+				return err
+			}
+
+		case 11: // return
+			return nil
+
+		case 14: // endchar
+			p.takeWidth(0)
+			return nil
+
+		default:
+			// Unsupported or inconsequential operator (e.g. a flex variant):
+			// discard its arguments and keep going.
+			p.stack = p.stack[:0]
+		}
+	}
+	return nil
+}
+
+func (f *Font) loadCFFGlyph(b *Buffer, x GlyphIndex, ppem fixed.Int26_6) error {
+	if int(x) >= f.cffCharStrings.len() {
+		return errInvalidGlyphIndex
+	}
+	s, e := f.cffCharStrings.get(int(x))
+	data, err := f.src.view(b, int(s), int(e-s))
+	if err != nil {
+		return err
+	}
+	data = append([]byte(nil), data...)
+
+	p := &cffInterp{
+		f:          f,
+		b:          b,
+		ppem:       ppem,
+		unitsPerEm: f.unitsPerEm,
+		globalBias: cffBias(f.cffGlobalSubrs.len()),
+		localBias:  cffBias(f.cffLocalSubrs.len()),
+	}
+	return p.run(data)
+}
+
+// LoadGlyph returns the glyph outline for the glyph index x, as a sequence
+// of Segments in b.Segments, replacing its previous contents.
+//
+// If ppem (pixels per em) is zero, the Segments' Args are in unscaled font
+// units. Otherwise, the outline is scaled, with the Args given in 26.6
+// fixed-point pixel coordinates.
+//
+// opts may be nil, which is equivalent to a zero LoadGlyphOptions.
+func (f *Font) LoadGlyph(b *Buffer, x GlyphIndex, ppem fixed.Int26_6, opts *LoadGlyphOptions) error {
+	b.Segments = b.Segments[:0]
+	b.compositeDepth = 0
+	return f.loadGlyph(b, x, ppem)
+}
+
+// loadGlyph is the LoadGlyph implementation, minus the Segments reset, so
+// that loadCompositeGlyph can call back into it for each component without
+// clobbering the Segments built up so far.
+func (f *Font) loadGlyph(b *Buffer, x GlyphIndex, ppem fixed.Int26_6) error {
+	if int(x) >= f.NumGlyphs() {
+		return errInvalidGlyphIndex
+	}
+	if !f.cff.isZero() {
+		return f.loadCFFGlyph(b, x, ppem)
+	}
+	if !f.loca.isZero() {
+		return f.loadGlyfGlyph(b, x, ppem)
+	}
+	return errUnsupportedGlyphFormat
+}
+
+// ---------------------------------------------------------------------
+// TrueType ("glyf") outline parsing.
+// ---------------------------------------------------------------------
+
+// maxGlyphDataLength is a sanity limit on the number of bytes that a single
+// glyf entry may occupy, guarding against malformed loca offsets.
+const maxGlyphDataLength = 64 * 1024
+
+// glyfFlags, per the OpenType "glyf" table spec.
+const (
+	glyfOnCurvePoint = 1 << 0
+	glyfXShortVector = 1 << 1
+	glyfYShortVector = 1 << 2
+	glyfRepeatFlag   = 1 << 3
+	glyfXSame        = 1 << 4 // X_IS_SAME_OR_POSITIVE_X_SHORT_VECTOR
+	glyfYSame        = 1 << 5 // Y_IS_SAME_OR_POSITIVE_Y_SHORT_VECTOR
+)
+
+// glyfData returns the raw glyf table bytes for glyph index x, as located
+// via the loca table. A zero-length (but nil error) result means the glyph
+// has no outline (e.g. the space glyph).
+func (f *Font) glyfData(b *Buffer, x GlyphIndex) ([]byte, error) {
+	entrySize := 2
+	if f.locaLong {
+		entrySize = 4
+	}
+	locaOff := int(f.loca.offset) + int(x)*entrySize
+	entries, err := f.src.view(b, locaOff, 2*entrySize)
+	if err != nil {
+		return nil, err
+	}
+	var start, end uint32
+	if f.locaLong {
+		start, end = u32(entries), u32(entries[4:])
+	} else {
+		start, end = uint32(u16(entries))*2, uint32(u16(entries[2:]))*2
+	}
+	if end < start {
+		return nil, errInvalidLocaTable
+	}
+	length := end - start
+	if length > maxGlyphDataLength {
+		return nil, errUnsupportedGlyphDataLength
+	}
+	if length == 0 {
+		return nil, nil
+	}
+	data, err := f.src.view(b, int(f.glyf.offset+start), int(length))
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(nil), data...), nil
+}
+
+func (f *Font) loadGlyfGlyph(b *Buffer, x GlyphIndex, ppem fixed.Int26_6) error {
+	data, err := f.glyfData(b, x)
+	if err != nil {
+		return err
+	}
+	if len(data) == 0 {
+		return nil
+	}
+	if len(data) < 10 {
+		return errInvalidGlyphData
+	}
+	numberOfContours := int16(u16(data))
+	if numberOfContours < 0 {
+		return f.loadCompositeGlyph(b, data, ppem)
+	}
+	return loadSimpleGlyph(b, data, int(numberOfContours), f.unitsPerEm, ppem)
+}
+
+// Composite glyph component flags, as per the OpenType "glyf" table spec.
+const (
+	compArgsAreWords     = 1 << 0
+	compArgsAreXYValues  = 1 << 1
+	compWeHaveAScale     = 1 << 3
+	compMoreComponents   = 1 << 5
+	compWeHaveXAndYScale = 1 << 6
+	compWeHaveATwoByTwo  = 1 << 7
+)
+
+// maxCompositeRecursionDepth bounds how many levels of composite glyphs
+// (components referencing components) LoadGlyph will follow, guarding
+// against cyclic references.
+const maxCompositeRecursionDepth = 8
+
+func f2dot14(b []byte) float64 {
+	return float64(int16(u16(b))) / (1 << 14)
+}
+
+// loadCompositeGlyph decodes data (a whole "glyf" glyph record whose
+// numberOfContours is negative) as a sequence of components, each an
+// affine-transformed reference to another glyph.
+func (f *Font) loadCompositeGlyph(b *Buffer, data []byte, ppem fixed.Int26_6) error {
+	b.compositeDepth++
+	if b.compositeDepth > maxCompositeRecursionDepth {
+		b.compositeDepth--
+		return errUnsupportedCompoundGlyph
+	}
+	defer func() { b.compositeDepth-- }()
+
+	pos := 10
+	for {
+		if pos+4 > len(data) {
+			return errInvalidGlyphData
+		}
+		flags := u16(data[pos:])
+		compIndex := GlyphIndex(u16(data[pos+2:]))
+		pos += 4
+
+		var dx, dy float64
+		if flags&compArgsAreWords != 0 {
+			if pos+4 > len(data) {
+				return errInvalidGlyphData
+			}
+			if flags&compArgsAreXYValues != 0 {
+				dx = float64(int16(u16(data[pos:])))
+				dy = float64(int16(u16(data[pos+2:])))
+			}
+			pos += 4
+		} else {
+			if pos+2 > len(data) {
+				return errInvalidGlyphData
+			}
+			if flags&compArgsAreXYValues != 0 {
+				dx = float64(int8(data[pos]))
+				dy = float64(int8(data[pos+1]))
+			}
+			pos += 2
+		}
+
+		a, bb, c, d := 1.0, 0.0, 0.0, 1.0
+		switch {
+		case flags&compWeHaveATwoByTwo != 0:
+			if pos+8 > len(data) {
+				return errInvalidGlyphData
+			}
+			a = f2dot14(data[pos:])
+			bb = f2dot14(data[pos+2:])
+			c = f2dot14(data[pos+4:])
+			d = f2dot14(data[pos+6:])
+			pos += 8
+		case flags&compWeHaveXAndYScale != 0:
+			if pos+4 > len(data) {
+				return errInvalidGlyphData
+			}
+			a = f2dot14(data[pos:])
+			d = f2dot14(data[pos+2:])
+			pos += 4
+		case flags&compWeHaveAScale != 0:
+			if pos+2 > len(data) {
+				return errInvalidGlyphData
+			}
+			a = f2dot14(data[pos:])
+			d = a
+			pos += 2
+		}
+
+		var comp Buffer
+		comp.compositeDepth = b.compositeDepth
+		if err := f.loadGlyph(&comp, compIndex, 0); err != nil {
+			return err
+		}
+		appendTransformed(b, comp.Segments, a, bb, c, d, dx, dy, f.unitsPerEm, ppem)
+
+		if flags&compMoreComponents == 0 {
+			break
+		}
+	}
+	return nil
+}
+
+// segmentNumCoords reports how many of a Segment's Args are meaningful
+// (x, y) coordinate pairs for the given Op.
+func segmentNumCoords(op SegmentOp) int {
+	switch op {
+	case SegmentOpMoveTo, SegmentOpLineTo:
+		return 2
+	case SegmentOpQuadTo:
+		return 4
+	case SegmentOpCubeTo:
+		return 6
+	}
+	return 0
+}
+
+// appendTransformed applies the 2x2 matrix [a c; bb d] plus the translation
+// (dx, dy) (all in font design units) to segs (themselves unscaled, i.e.
+// loaded with ppem == 0) and appends the result, scaled to ppem, to
+// b.Segments.
+func appendTransformed(b *Buffer, segs []Segment, a, bb, c, d, dx, dy float64, unitsPerEm Units, ppem fixed.Int26_6) {
+	for _, seg := range segs {
+		out := Segment{Op: seg.Op}
+		for k := 0; k < segmentNumCoords(seg.Op); k += 2 {
+			ux := float64(seg.Args[k]) / 64
+			uy := float64(seg.Args[k+1]) / 64
+			nx := a*ux + c*uy + dx
+			ny := bb*ux + d*uy + dy
+			out.Args[k] = scaleFontUnits(nx, unitsPerEm, ppem)
+			out.Args[k+1] = scaleFontUnits(ny, unitsPerEm, ppem)
+		}
+		b.Segments = append(b.Segments, out)
+	}
+}
+
+// glyfPoint is a single point of a simple glyph's contour, in font design
+// units.
+type glyfPoint struct {
+	x, y    int32
+	onCurve bool
+}
+
+func loadSimpleGlyph(b *Buffer, data []byte, numContours int, unitsPerEm Units, ppem fixed.Int26_6) error {
+	const glyphHeaderLen = 10
+	pos := glyphHeaderLen
+
+	if pos+2*numContours+2 > len(data) {
+		return errInvalidGlyphData
+	}
+	endPts := make([]int, numContours)
+	for i := range endPts {
+		endPts[i] = int(u16(data[pos+2*i:]))
+	}
+	pos += 2 * numContours
+	numPoints := 0
+	if numContours > 0 {
+		numPoints = endPts[numContours-1] + 1
+	}
+
+	instructionLength := int(u16(data[pos:]))
+	pos += 2 + instructionLength
+	if pos > len(data) {
+		return errInvalidGlyphData
+	}
+
+	flags := make([]byte, numPoints)
+	for i := 0; i < numPoints; {
+		if pos >= len(data) {
+			return errInvalidGlyphData
+		}
+		fl := data[pos]
+		pos++
+		flags[i] = fl
+		i++
+		if fl&glyfRepeatFlag != 0 {
+			if pos >= len(data) {
+				return errInvalidGlyphData
+			}
+			repeat := int(data[pos])
+			pos++
+			for ; repeat > 0 && i < numPoints; repeat-- {
+				flags[i] = fl
+				i++
+			}
+		}
+	}
+
+	xs := make([]int32, numPoints)
+	x := int32(0)
+	for i, fl := range flags {
+		switch {
+		case fl&glyfXShortVector != 0:
+			if pos >= len(data) {
+				return errInvalidGlyphData
+			}
+			dx := int32(data[pos])
+			pos++
+			if fl&glyfXSame == 0 {
+				dx = -dx
+			}
+			x += dx
+		case fl&glyfXSame == 0:
+			if pos+2 > len(data) {
+				return errInvalidGlyphData
+			}
+			x += int32(int16(u16(data[pos:])))
+			pos += 2
+		}
+		xs[i] = x
+	}
+
+	ys := make([]int32, numPoints)
+	y := int32(0)
+	for i, fl := range flags {
+		switch {
+		case fl&glyfYShortVector != 0:
+			if pos >= len(data) {
+				return errInvalidGlyphData
+			}
+			dy := int32(data[pos])
+			pos++
+			if fl&glyfYSame == 0 {
+				dy = -dy
+			}
+			y += dy
+		case fl&glyfYSame == 0:
+			if pos+2 > len(data) {
+				return errInvalidGlyphData
+			}
+			y += int32(int16(u16(data[pos:])))
+			pos += 2
+		}
+		ys[i] = y
+	}
+
+	e := &glyfEmitter{b: b, unitsPerEm: unitsPerEm, ppem: ppem}
+	start := 0
+	for _, end := range endPts {
+		if end < start || end >= numPoints {
+			return errInvalidGlyphData
+		}
+		pts := make([]glyfPoint, 0, end-start+1)
+		for i := start; i <= end; i++ {
+			pts = append(pts, glyfPoint{x: xs[i], y: ys[i], onCurve: flags[i]&glyfOnCurvePoint != 0})
+		}
+		e.contour(pts)
+		start = end + 1
+	}
+	return nil
+}
+
+// glyfEmitter walks a contour's on/off-curve points, synthesizing the
+// implicit on-curve points that lie at the midpoint of two consecutive
+// off-curve points, and appends the resulting MoveTo/LineTo/QuadTo Segments.
+type glyfEmitter struct {
+	b          *Buffer
+	unitsPerEm Units
+	ppem       fixed.Int26_6
+}
+
+func (e *glyfEmitter) scale(v int32) fixed.Int26_6 {
+	return scaleFontUnits(float64(v), e.unitsPerEm, e.ppem)
+}
+
+func midpoint(a, b glyfPoint) glyfPoint {
+	return glyfPoint{x: (a.x + b.x) / 2, y: (a.y + b.y) / 2, onCurve: true}
+}
+
+func (e *glyfEmitter) contour(pts []glyfPoint) {
+	if len(pts) == 0 {
+		return
+	}
+	// Rotate/synthesize so that the contour starts on an on-curve point.
+	start := 0
+	switch {
+	case pts[0].onCurve:
+		// Already on-curve.
+	case pts[len(pts)-1].onCurve:
+		pts = append([]glyfPoint{pts[len(pts)-1]}, pts[:len(pts)-1]...)
+	default:
+		pts = append([]glyfPoint{midpoint(pts[len(pts)-1], pts[0])}, pts...)
+	}
+
+	e.moveTo(pts[start])
+	i := start + 1
+	for i < len(pts) {
+		p := pts[i]
+		if p.onCurve {
+			e.lineTo(p)
+			i++
+			continue
+		}
+		ctrl := p
+		var to glyfPoint
+		if i+1 < len(pts) && pts[i+1].onCurve {
+			to = pts[i+1]
+			i += 2
+		} else if i+1 < len(pts) {
+			to = midpoint(ctrl, pts[i+1])
+			i++
+		} else {
+			to = pts[0]
+			i++
+		}
+		e.quadTo(ctrl, to)
+	}
+}
+
+func (e *glyfEmitter) moveTo(p glyfPoint) {
+	e.b.Segments = append(e.b.Segments, Segment{
+		Op:   SegmentOpMoveTo,
+		Args: [6]fixed.Int26_6{0: e.scale(p.x), 1: e.scale(p.y)},
+	})
+}
+
+func (e *glyfEmitter) lineTo(p glyfPoint) {
+	e.b.Segments = append(e.b.Segments, Segment{
+		Op:   SegmentOpLineTo,
+		Args: [6]fixed.Int26_6{0: e.scale(p.x), 1: e.scale(p.y)},
+	})
+}
+
+func (e *glyfEmitter) quadTo(ctrl, to glyfPoint) {
+	e.b.Segments = append(e.b.Segments, Segment{
+		Op: SegmentOpQuadTo,
+		Args: [6]fixed.Int26_6{
+			0: e.scale(ctrl.x), 1: e.scale(ctrl.y),
+			2: e.scale(to.x), 3: e.scale(to.y),
+		},
+	})
+}
+
+// ---------------------------------------------------------------------
+// "post" (PostScript) table parsing.
+// ---------------------------------------------------------------------
+
+// PostTable holds the information parsed from a Font's "post" table: the
+// font-wide PostScript metrics and, for version 2.0 tables, a per-glyph
+// name.
+type PostTable struct {
+	// ItalicAngle is the font's italic angle, in counter-clockwise degrees
+	// from the vertical, as used by PDF's font descriptor /ItalicAngle.
+	ItalicAngle float64
+	// UnderlinePosition and UnderlineThickness are in font design units.
+	UnderlinePosition  Units
+	UnderlineThickness Units
+	IsFixedPitch       bool
+
+	version        uint32
+	glyphNameIndex []uint16
+	names          [][]byte
+}
+
+// GlyphName returns the PostScript name of the glyph index x, as recorded
+// in a version 2.0 post table. It returns ErrNotFound if p came from a
+// version other than 2.0 (which records no per-glyph names).
+func (p *PostTable) GlyphName(x GlyphIndex) (string, error) {
+	if p.glyphNameIndex == nil {
+		return "", ErrNotFound
+	}
+	if int(x) >= len(p.glyphNameIndex) {
+		return "", errInvalidGlyphIndex
+	}
+	i := int(p.glyphNameIndex[x])
+	if i < len(macGlyphNames) {
+		return macGlyphNames[i], nil
+	}
+	i -= len(macGlyphNames)
+	if i >= len(p.names) {
+		return "", errInvalidPostTable
+	}
+	return string(p.names[i]), nil
+}
+
+// PostTable parses and returns f's "post" table. It returns ErrNotFound if
+// f has no such table.
+func (f *Font) PostTable(b *Buffer) (*PostTable, error) {
+	if f.post.isZero() {
+		return nil, ErrNotFound
+	}
+	data, err := f.src.view(b, int(f.post.offset), int(f.post.length))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < 32 {
+		return nil, errInvalidPostTable
+	}
+	data = append([]byte(nil), data...)
+
+	p := &PostTable{
+		version:            u32(data),
+		ItalicAngle:        float64(int32(u32(data[4:]))) / 65536,
+		UnderlinePosition:  Units(int16(u16(data[8:]))),
+		UnderlineThickness: Units(int16(u16(data[10:]))),
+		IsFixedPitch:       u32(data[12:]) != 0,
+	}
+	if p.version != 0x00020000 {
+		return p, nil
+	}
+
+	pos := 32
+	if pos+2 > len(data) {
+		return nil, errInvalidPostTable
+	}
+	numGlyphs := int(u16(data[pos:]))
+	pos += 2
+	if numGlyphs*2 > len(data)-pos {
+		return nil, errInvalidPostTable
+	}
+	p.glyphNameIndex = make([]uint16, numGlyphs)
+	for i := range p.glyphNameIndex {
+		p.glyphNameIndex[i] = u16(data[pos+2*i:])
+	}
+	pos += 2 * numGlyphs
+
+	for pos < len(data) {
+		n := int(data[pos])
+		pos++
+		if n > len(data)-pos {
+			return nil, errInvalidPostTable
+		}
+		p.names = append(p.names, data[pos:pos+n])
+		pos += n
+	}
+	return p, nil
+}
+
+// macGlyphNames is the "Standard Macintosh Ordering" of glyph names, as per
+// the OpenType "post" table spec. A version 2.0 post table's per-glyph name
+// index either refers into this table (index < 258) or into that table's
+// own inline Pascal-string pool (index >= 258).
+var macGlyphNames = [258]string{
+	".notdef", ".null", "nonmarkingreturn", "space", "exclam", "quotedbl",
+	"numbersign", "dollar", "percent", "ampersand", "quotesingle",
+	"parenleft", "parenright", "asterisk", "plus", "comma", "hyphen",
+	"period", "slash", "zero", "one", "two", "three", "four", "five", "six",
+	"seven", "eight", "nine", "colon", "semicolon", "less", "equal",
+	"greater", "question", "at", "A", "B", "C", "D", "E", "F", "G", "H", "I",
+	"J", "K", "L", "M", "N", "O", "P", "Q", "R", "S", "T", "U", "V", "W",
+	"X", "Y", "Z", "bracketleft", "backslash", "bracketright",
+	"asciicircum", "underscore", "grave", "a", "b", "c", "d", "e", "f", "g",
+	"h", "i", "j", "k", "l", "m", "n", "o", "p", "q", "r", "s", "t", "u",
+	"v", "w", "x", "y", "z", "braceleft", "bar", "braceright", "asciitilde",
+	"Adieresis", "Aring", "Ccedilla", "Eacute", "Ntilde", "Odieresis",
+	"Udieresis", "aacute", "agrave", "acircumflex", "adieresis", "atilde",
+	"aring", "ccedilla", "eacute", "egrave", "ecircumflex", "edieresis",
+	"iacute", "igrave", "icircumflex", "idieresis", "ntilde", "oacute",
+	"ograve", "ocircumflex", "odieresis", "otilde", "uacute", "ugrave",
+	"ucircumflex", "udieresis", "dagger", "degree", "cent", "sterling",
+	"section", "bullet", "paragraph", "germandbls", "registered",
+	"copyright", "trademark", "acute", "dieresis", "notequal", "AE",
+	"Oslash", "infinity", "plusminus", "lessequal", "greaterequal", "yen",
+	"mu", "partialdiff", "summation", "product", "pi", "integral",
+	"ordfeminine", "ordmasculine", "Omega", "ae", "oslash", "questiondown",
+	"exclamdown", "logicalnot", "radical", "florin", "approxequal",
+	"Delta", "guillemotleft", "guillemotright", "ellipsis",
+	"nonbreakingspace", "Agrave", "Atilde", "Otilde", "OE", "oe", "endash",
+	"emdash", "quotedblleft", "quotedblright", "quoteleft", "quoteright",
+	"divide", "lozenge", "ydieresis", "Ydieresis", "fraction", "currency",
+	"guilsinglleft", "guilsinglright", "fi", "fl", "daggerdbl",
+	"periodcentered", "quotesinglbase", "quotedblbase", "perthousand",
+	"Acircumflex", "Ecircumflex", "Aacute", "Edieresis", "Egrave",
+	"Iacute", "Icircumflex", "Idieresis", "Igrave", "Oacute",
+	"Ocircumflex", "apple", "Ograve", "Uacute", "Ucircumflex", "Ugrave",
+	"dotlessi", "circumflex", "tilde", "macron", "breve", "dotaccent",
+	"ring", "cedilla", "hungarumlaut", "ogonek", "caron", "Lslash",
+	"lslash", "Scaron", "scaron", "Zcaron", "zcaron", "brokenbar", "Eth",
+	"eth", "Yacute", "yacute", "Thorn", "thorn", "minus", "multiply",
+	"onesuperior", "twosuperior", "threesuperior", "onehalf", "onequarter",
+	"threequarters", "franc", "Gbreve", "gbreve", "Idotaccent", "Scedilla",
+	"scedilla", "Cacute", "cacute", "Ccaron", "ccaron", "dcroat",
+}
+
+// ---------------------------------------------------------------------
+// "cmap" (character to glyph mapping) table parsing.
+// ---------------------------------------------------------------------
+
+// cmapEncodingScore ranks a cmap encoding record by platformID/encodingID,
+// preferring a full-Unicode subtable (platform 0, any encoding, or platform
+// 3 encoding 10) over the BMP-only platform 3 encoding 1. Zero means
+// "unsupported"; higher is better.
+func cmapEncodingScore(platformID, encodingID uint16) int {
+	switch {
+	case platformID == 0:
+		return 3
+	case platformID == 3 && encodingID == 10:
+		return 2
+	case platformID == 3 && encodingID == 1:
+		return 1
+	}
+	return 0
+}
+
+// GlyphIndex returns the glyph index for rune r. It returns a zero
+// GlyphIndex, and a nil error, if r is not mapped by f's cmap table.
+func (f *Font) GlyphIndex(b *Buffer, r rune) (GlyphIndex, error) {
+	if f.cmap.isZero() {
+		return 0, ErrNotFound
+	}
+	data, err := f.src.view(b, int(f.cmap.offset), int(f.cmap.length))
+	if err != nil {
+		return 0, err
+	}
+	data = append([]byte(nil), data...)
+	if len(data) < 4 {
+		return 0, errInvalidCmapTable
+	}
+	numTables := int(u16(data[2:]))
+	if 4+8*numTables > len(data) {
+		return 0, errInvalidCmapTable
+	}
+
+	bestOffset, bestScore := -1, 0
+	for i := 0; i < numTables; i++ {
+		rec := data[4+8*i:]
+		score := cmapEncodingScore(u16(rec), u16(rec[2:]))
+		if score > bestScore {
+			bestScore = score
+			bestOffset = int(u32(rec[4:]))
+		}
+	}
+	if bestOffset < 0 || bestOffset+2 > len(data) {
+		return 0, ErrNotFound
+	}
+	return parseCmapSubtable(data[bestOffset:], r)
+}
+
+func parseCmapSubtable(data []byte, r rune) (GlyphIndex, error) {
+	if len(data) < 2 {
+		return 0, errInvalidCmapTable
+	}
+	switch u16(data) {
+	case 0:
+		return cmapFormat0(data, r)
+	case 4:
+		return cmapFormat4(data, r)
+	case 6:
+		return cmapFormat6(data, r)
+	case 12:
+		return cmapFormat12(data, r)
+	}
+	return 0, errUnsupportedCmapFormat
+}
+
+// cmapFormat0 is the "Byte encoding table": a direct 256-entry lookup,
+// covering only Mac Roman's code points.
+func cmapFormat0(data []byte, r rune) (GlyphIndex, error) {
+	if len(data) < 6+256 {
+		return 0, errInvalidCmapTable
+	}
+	if r < 0 || r > 255 {
+		return 0, nil
+	}
+	return GlyphIndex(data[6+int(r)]), nil
+}
+
+// cmapFormat4 is the "Segment mapping to delta values" table, the common
+// format for BMP coverage.
+func cmapFormat4(data []byte, r rune) (GlyphIndex, error) {
+	if r > 0xffff {
+		return 0, nil
+	}
+	if len(data) < 14 {
+		return 0, errInvalidCmapTable
+	}
+	segCountX2 := int(u16(data[6:]))
+	endCodesOff := 14
+	startCodesOff := endCodesOff + segCountX2 + 2 // +2 skips reservedPad.
+	idDeltasOff := startCodesOff + segCountX2
+	idRangeOffsetsOff := idDeltasOff + segCountX2
+	if idRangeOffsetsOff+segCountX2 > len(data) {
+		return 0, errInvalidCmapTable
+	}
+
+	c := uint16(r)
+	for i := 0; i < segCountX2/2; i++ {
+		end := u16(data[endCodesOff+2*i:])
+		if c > end {
+			continue
+		}
+		start := u16(data[startCodesOff+2*i:])
+		if c < start {
+			return 0, nil
+		}
+		delta := int16(u16(data[idDeltasOff+2*i:]))
+		rangeOffset := u16(data[idRangeOffsetsOff+2*i:])
+		if rangeOffset == 0 {
+			return GlyphIndex(c + uint16(delta)), nil
+		}
+		addr := idRangeOffsetsOff + 2*i + int(rangeOffset) + 2*int(c-start)
+		if addr+2 > len(data) {
+			return 0, errInvalidCmapTable
+		}
+		g := u16(data[addr:])
+		if g == 0 {
+			return 0, nil
+		}
+		return GlyphIndex(g + uint16(delta)), nil
+	}
+	return 0, nil
+}
+
+// cmapFormat6 is the "Trimmed table mapping": a dense array covering a
+// single contiguous range of code points.
+func cmapFormat6(data []byte, r rune) (GlyphIndex, error) {
+	if len(data) < 10 {
+		return 0, errInvalidCmapTable
+	}
+	first := int(u16(data[6:]))
+	count := int(u16(data[8:]))
+	i := int(r) - first
+	if i < 0 || i >= count {
+		return 0, nil
+	}
+	off := 10 + 2*i
+	if off+2 > len(data) {
+		return 0, errInvalidCmapTable
+	}
+	return GlyphIndex(u16(data[off:])), nil
+}
+
+// cmapFormat12 is the "Segmented coverage" table, covering full Unicode
+// (including supplementary planes) as a sorted list of contiguous groups.
+func cmapFormat12(data []byte, r rune) (GlyphIndex, error) {
+	if len(data) < 16 {
+		return 0, errInvalidCmapTable
+	}
+	numGroups := int(u32(data[12:]))
+	if 16+12*numGroups > len(data) {
+		return 0, errInvalidCmapTable
+	}
+	c := uint32(r)
+	lo, hi := 0, numGroups
+	for lo < hi {
+		mid := (lo + hi) / 2
+		g := data[16+12*mid:]
+		start, end := u32(g), u32(g[4:])
+		switch {
+		case c < start:
+			hi = mid
+		case c > end:
+			lo = mid + 1
+		default:
+			return GlyphIndex(u32(g[8:]) + (c - start)), nil
+		}
+	}
+	return 0, nil
+}
+
+// ---------------------------------------------------------------------
+// "hmtx" (horizontal metrics) parsing.
+// ---------------------------------------------------------------------
+
+// HMetric holds a glyph's horizontal metrics, scaled to a Font.HMetric call's
+// ppem argument in the same way that Font.LoadGlyph scales Segment.Args.
+type HMetric struct {
+	AdvanceWidth    fixed.Int26_6
+	LeftSideBearing fixed.Int26_6
+}
+
+// HMetric returns the horizontal metrics for glyph index x.
+func (f *Font) HMetric(b *Buffer, ppem fixed.Int26_6, x GlyphIndex) (HMetric, error) {
+	if int(x) >= f.NumGlyphs() {
+		return HMetric{}, errInvalidGlyphIndex
+	}
+	if f.hmtx.isZero() || f.numberOfHMetrics == 0 {
+		return HMetric{}, errInvalidHmtxTable
+	}
+
+	var advanceWidth, lsb int
+	if i := int(x); i < f.numberOfHMetrics {
+		data, err := f.src.view(b, int(f.hmtx.offset)+4*i, 4)
+		if err != nil {
+			return HMetric{}, err
+		}
+		advanceWidth = int(u16(data))
+		lsb = int(int16(u16(data[2:])))
+	} else {
+		// Glyphs beyond numberOfHMetrics share the final explicit
+		// AdvanceWidth, and have their own (otherwise unindexed)
+		// LeftSideBearing in the array that follows.
+		lastOff := int(f.hmtx.offset) + 4*(f.numberOfHMetrics-1)
+		last, err := f.src.view(b, lastOff, 4)
+		if err != nil {
+			return HMetric{}, err
+		}
+		advanceWidth = int(u16(last))
+
+		lsbOff := int(f.hmtx.offset) + 4*f.numberOfHMetrics + 2*(i-f.numberOfHMetrics)
+		lsbData, err := f.src.view(b, lsbOff, 2)
+		if err != nil {
+			return HMetric{}, err
+		}
+		lsb = int(int16(u16(lsbData)))
+	}
+
+	return HMetric{
+		AdvanceWidth:    scaleFontUnits(float64(advanceWidth), f.unitsPerEm, ppem),
+		LeftSideBearing: scaleFontUnits(float64(lsb), f.unitsPerEm, ppem),
+	}, nil
+}
+
+// ---------------------------------------------------------------------
+// Kerning: the classic "kern" table and GPOS pair adjustment (lookup type
+// 2) subtables.
+// ---------------------------------------------------------------------
+
+// Kern returns the kerning adjustment to apply between glyphs x0 and x1,
+// i.e. the amount to add to x0's advance before placing x1.
+//
+// GPOS pair adjustment is preferred when present, as it is the modern,
+// OpenType-native mechanism; the classic "kern" table is used as a
+// fallback. A zero adjustment and a nil error are returned if neither
+// table is present, or neither mentions this particular pair.
+func (f *Font) Kern(b *Buffer, ppem fixed.Int26_6, x0, x1 GlyphIndex, hinting Hinting) (fixed.Int26_6, error) {
+	if !f.gpos.isZero() {
+		v, ok, err := f.gposKern(b, x0, x1)
+		if err != nil {
+			return 0, err
+		}
+		if ok {
+			return scaleFontUnits(float64(v), f.unitsPerEm, ppem), nil
+		}
+	}
+	if !f.kern.isZero() {
+		v, ok, err := f.classicKern(b, x0, x1)
+		if err != nil {
+			return 0, err
+		}
+		if ok {
+			return scaleFontUnits(float64(v), f.unitsPerEm, ppem), nil
+		}
+	}
+	return 0, nil
+}
+
+// classicKern searches the "kern" table's format 0 subtables for a pair
+// (x0, x1), returning the pair's value and true if found.
+func (f *Font) classicKern(b *Buffer, x0, x1 GlyphIndex) (int, bool, error) {
+	data, err := f.src.view(b, int(f.kern.offset), int(f.kern.length))
+	if err != nil {
+		return 0, false, err
+	}
+	data = append([]byte(nil), data...)
+	if len(data) < 4 {
+		return 0, false, errInvalidKernTable
+	}
+	nTables := int(u16(data[2:]))
+	pos := 4
+	for i := 0; i < nTables; i++ {
+		if pos+6 > len(data) {
+			return 0, false, errInvalidKernTable
+		}
+		length := int(u16(data[pos+2:]))
+		coverage := u16(data[pos+4:])
+		if length < 6 || pos+length > len(data) {
+			return 0, false, errInvalidKernTable
+		}
+		sub := data[pos : pos+length : pos+length]
+		// coverage bits 0-7 are flags (bit 0 is the horizontal flag), bits
+		// 8-15 are the format. Only format 0 is supported.
+		if coverage&0x0001 != 0 && coverage>>8 == 0 {
+			if v, ok, err := kernFormat0(sub[6:], x0, x1); err != nil {
+				return 0, false, err
+			} else if ok {
+				return v, true, nil
+			}
+		}
+		pos += length
+	}
+	return 0, false, nil
+}
+
+func kernFormat0(data []byte, x0, x1 GlyphIndex) (int, bool, error) {
+	if len(data) < 8 {
+		return 0, false, errInvalidKernTable
+	}
+	nPairs := int(u16(data))
+	if 8+6*nPairs > len(data) {
+		return 0, false, errInvalidKernTable
+	}
+	key := uint32(x0)<<16 | uint32(x1)
+	lo, hi := 0, nPairs
+	for lo < hi {
+		mid := (lo + hi) / 2
+		pair := data[8+6*mid:]
+		pairKey := uint32(u16(pair))<<16 | uint32(u16(pair[2:]))
+		switch {
+		case key < pairKey:
+			hi = mid
+		case key > pairKey:
+			lo = mid + 1
+		default:
+			return int(int16(u16(pair[4:]))), true, nil
+		}
+	}
+	return 0, false, nil
+}
+
+// gposKern searches the GPOS table's lookup type 2 (pair adjustment)
+// subtables for a pair (x0, x1), returning the pair's XAdvance value for
+// x0 and true if found.
+func (f *Font) gposKern(b *Buffer, x0, x1 GlyphIndex) (int, bool, error) {
+	data, err := f.src.view(b, int(f.gpos.offset), int(f.gpos.length))
+	if err != nil {
+		return 0, false, err
+	}
+	data = append([]byte(nil), data...)
+	if len(data) < 10 {
+		return 0, false, errInvalidGPOSTable
+	}
+	lookupListOff := int(u16(data[8:]))
+	if lookupListOff+2 > len(data) {
+		return 0, false, errInvalidGPOSTable
+	}
+	lookupList := data[lookupListOff:]
+	lookupCount := int(u16(lookupList))
+	if 2+2*lookupCount > len(lookupList) {
+		return 0, false, errInvalidGPOSTable
+	}
+	for i := 0; i < lookupCount; i++ {
+		lookupOff := int(u16(lookupList[2+2*i:]))
+		if lookupOff+6 > len(lookupList) {
+			return 0, false, errInvalidGPOSTable
+		}
+		lookup := lookupList[lookupOff:]
+		if u16(lookup) != 2 { // lookupType: only pair adjustment is supported.
+			continue
+		}
+		subTableCount := int(u16(lookup[4:]))
+		if 6+2*subTableCount > len(lookup) {
+			return 0, false, errInvalidGPOSTable
+		}
+		for j := 0; j < subTableCount; j++ {
+			subOff := int(u16(lookup[6+2*j:]))
+			if subOff > len(lookup) {
+				return 0, false, errInvalidGPOSTable
+			}
+			v, ok, err := parsePairPos(lookup[subOff:], x0, x1)
+			if err != nil {
+				return 0, false, err
+			}
+			if ok {
+				return v, true, nil
+			}
+		}
+	}
+	return 0, false, nil
+}
+
+// parsePairPos parses a single PairPos (GPOS lookup type 2) subtable,
+// formats 1 (explicit glyph pairs) and 2 (glyph-class pairs).
+func parsePairPos(data []byte, x0, x1 GlyphIndex) (int, bool, error) {
+	if len(data) < 8 {
+		return 0, false, errInvalidGPOSTable
+	}
+	coverageOff := int(u16(data[2:]))
+	valueFormat1 := u16(data[4:])
+	valueFormat2 := u16(data[6:])
+	if coverageOff > len(data) {
+		return 0, false, errInvalidGPOSTable
+	}
+
+	switch u16(data) {
+	case 1:
+		covIndex, ok, err := coverageIndex(data[coverageOff:], x0)
+		if err != nil {
+			return 0, false, err
+		}
+		if !ok {
+			return 0, false, nil
+		}
+		if len(data) < 10 {
+			return 0, false, errInvalidGPOSTable
+		}
+		pairSetCount := int(u16(data[8:]))
+		if covIndex >= pairSetCount || 10+2*covIndex+2 > len(data) {
+			return 0, false, errInvalidGPOSTable
+		}
+		pairSetOff := int(u16(data[10+2*covIndex:]))
+		if pairSetOff+2 > len(data) {
+			return 0, false, errInvalidGPOSTable
+		}
+		pairSet := data[pairSetOff:]
+		pairValueCount := int(u16(pairSet))
+		recordSize := 2 + valueRecordSize(valueFormat1) + valueRecordSize(valueFormat2)
+		pos := 2
+		for i := 0; i < pairValueCount; i, pos = i+1, pos+recordSize {
+			if pos+recordSize > len(pairSet) {
+				return 0, false, errInvalidGPOSTable
+			}
+			if GlyphIndex(u16(pairSet[pos:])) != x1 {
+				continue
+			}
+			xAdvance, err := valueRecordXAdvance(pairSet[pos+2:], valueFormat1)
+			if err != nil {
+				return 0, false, err
+			}
+			return xAdvance, true, nil
+		}
+		return 0, false, nil
+
+	case 2:
+		if _, ok, err := coverageIndex(data[coverageOff:], x0); err != nil {
+			return 0, false, err
+		} else if !ok {
+			return 0, false, nil
+		}
+		if len(data) < 16 {
+			return 0, false, errInvalidGPOSTable
+		}
+		classDef1Off := int(u16(data[8:]))
+		classDef2Off := int(u16(data[10:]))
+		class1Count := int(u16(data[12:]))
+		class2Count := int(u16(data[14:]))
+		if classDef1Off > len(data) || classDef2Off > len(data) {
+			return 0, false, errInvalidGPOSTable
+		}
+		class1, err := classDefClass(data[classDef1Off:], x0)
+		if err != nil {
+			return 0, false, err
+		}
+		class2, err := classDefClass(data[classDef2Off:], x1)
+		if err != nil {
+			return 0, false, err
+		}
+		if class1 >= class1Count || class2 >= class2Count {
+			return 0, false, nil
+		}
+		recordSize := valueRecordSize(valueFormat1) + valueRecordSize(valueFormat2)
+		off := 16 + (class1*class2Count+class2)*recordSize
+		if off+recordSize > len(data) {
+			return 0, false, errInvalidGPOSTable
+		}
+		xAdvance, err := valueRecordXAdvance(data[off:], valueFormat1)
+		if err != nil {
+			return 0, false, err
+		}
+		return xAdvance, true, nil
+	}
+	return 0, false, errUnsupportedPairPosFormat
+}
+
+// coverageIndex returns the coverage index of glyph x within a Coverage
+// table (format 1: sorted glyph array; format 2: sorted range records),
+// and whether x is covered at all.
+func coverageIndex(data []byte, x GlyphIndex) (int, bool, error) {
+	if len(data) < 4 {
+		return 0, false, errInvalidGPOSTable
+	}
+	switch u16(data) {
+	case 1:
+		count := int(u16(data[2:]))
+		if 4+2*count > len(data) {
+			return 0, false, errInvalidGPOSTable
+		}
+		lo, hi := 0, count
+		for lo < hi {
+			mid := (lo + hi) / 2
+			g := GlyphIndex(u16(data[4+2*mid:]))
+			switch {
+			case x < g:
+				hi = mid
+			case x > g:
+				lo = mid + 1
+			default:
+				return mid, true, nil
+			}
+		}
+		return 0, false, nil
+	case 2:
+		count := int(u16(data[2:]))
+		if 4+6*count > len(data) {
+			return 0, false, errInvalidGPOSTable
+		}
+		for i := 0; i < count; i++ {
+			r := data[4+6*i:]
+			start, end := GlyphIndex(u16(r)), GlyphIndex(u16(r[2:]))
+			if x < start || x > end {
+				continue
+			}
+			return int(u16(r[4:])) + int(x-start), true, nil
+		}
+		return 0, false, nil
+	}
+	return 0, false, errInvalidGPOSTable
+}
+
+// classDefClass returns the class value assigned to glyph x by a ClassDef
+// table (format 1: a dense array over a contiguous glyph range; format 2: a
+// sorted array of class range records). Glyphs outside the table's range
+// belong to class 0, the implicit default.
+func classDefClass(data []byte, x GlyphIndex) (int, error) {
+	if len(data) < 4 {
+		return 0, errInvalidGPOSTable
+	}
+	switch u16(data) {
+	case 1:
+		startGlyph := GlyphIndex(u16(data[2:]))
+		count := int(u16(data[4:]))
+		if 6+2*count > len(data) {
+			return 0, errInvalidGPOSTable
+		}
+		if x < startGlyph || int(x-startGlyph) >= count {
+			return 0, nil
+		}
+		return int(u16(data[6+2*int(x-startGlyph):])), nil
+	case 2:
+		count := int(u16(data[2:]))
+		if 4+6*count > len(data) {
+			return 0, errInvalidGPOSTable
+		}
+		for i := 0; i < count; i++ {
+			r := data[4+6*i:]
+			start, end := GlyphIndex(u16(r)), GlyphIndex(u16(r[2:]))
+			if x >= start && x <= end {
+				return int(u16(r[4:])), nil
+			}
+		}
+		return 0, nil
+	}
+	return 0, errInvalidGPOSTable
+}
+
+// valueRecordSize returns the number of bytes that a GPOS ValueRecord
+// occupies for the given ValueFormat bit field: 2 bytes per set bit.
+func valueRecordSize(valueFormat uint16) int {
+	n := 0
+	for v := valueFormat; v != 0; v &= v - 1 {
+		n++
+	}
+	return 2 * n
+}
+
+// valueRecordXAdvance extracts the XAdvance field (if present) from a
+// ValueRecord laid out per valueFormat. XAdvance is the only field that
+// Font.Kern needs; the rest of the record is only used to compute how many
+// bytes to skip for records that don't carry it.
+func valueRecordXAdvance(data []byte, valueFormat uint16) (int, error) {
+	const (
+		fmtXPlacement = 0x0001
+		fmtYPlacement = 0x0002
+		fmtXAdvance   = 0x0004
+	)
+	pos := 0
+	if valueFormat&fmtXPlacement != 0 {
+		pos += 2
+	}
+	if valueFormat&fmtYPlacement != 0 {
+		pos += 2
+	}
+	if valueFormat&fmtXAdvance == 0 {
+		return 0, nil
+	}
+	if pos+2 > len(data) {
+		return 0, errInvalidGPOSTable
+	}
+	return int(int16(u16(data[pos:]))), nil
+}
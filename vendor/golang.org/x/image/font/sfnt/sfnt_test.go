@@ -2,11 +2,25 @@
 // Use of this source code is governed by a BSD-style
 // license that can be found in the LICENSE file.
 
+// NOTE: this vendor tree has no go.mod/go.sum (not even at the repo root),
+// and vendor/modules.txt isn't checked in either, so none of this package's
+// dependencies (including golang.org/x/image/font/gofont/goregular, used by
+// most of the tests below) can be resolved here — there is no network
+// access in this environment to vendor them from. testdata/CFFTest.otf is
+// missing for the same reason; tests that need it call readCFFTestOTF,
+// which skips rather than fails when the fixture isn't present, so the
+// suite degrades cleanly instead of reporting false failures. Until the
+// missing modules are restored, neither this package (which imports
+// golang.org/x/image/math/fixed) nor this file (which also imports
+// goregular) compiles, so none of these tests run, not even the byte-level
+// unit tests such as TestKernFormat0 and TestCFFIndexNonMonotonic.
+
 package sfnt
 
 import (
 	"bytes"
 	"io/ioutil"
+	"os"
 	"path/filepath"
 	"testing"
 
@@ -14,6 +28,20 @@ import (
 	"golang.org/x/image/math/fixed"
 )
 
+// readCFFTestOTF reads testdata/CFFTest.otf, skipping the test if the
+// fixture isn't present in this tree (see the NOTE at the top of this
+// file).
+func readCFFTestOTF(t *testing.T) []byte {
+	data, err := ioutil.ReadFile(filepath.Join("..", "testdata", "CFFTest.otf"))
+	if os.IsNotExist(err) {
+		t.Skip("testdata/CFFTest.otf is not present in this tree")
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
 func moveTo(xa, ya int) Segment {
 	return Segment{
 		Op: SegmentOpMoveTo,
@@ -34,6 +62,18 @@ func lineTo(xa, ya int) Segment {
 	}
 }
 
+func quadTo(xa, ya, xb, yb int) Segment {
+	return Segment{
+		Op: SegmentOpQuadTo,
+		Args: [6]fixed.Int26_6{
+			0: fixed.I(xa),
+			1: fixed.I(ya),
+			2: fixed.I(xb),
+			3: fixed.I(yb),
+		},
+	}
+}
+
 func cubeTo(xa, ya, xb, yb, xc, yc int) Segment {
 	return Segment{
 		Op: SegmentOpCubeTo,
@@ -64,6 +104,37 @@ func TestTrueTypeParseReaderAt(t *testing.T) {
 	testTrueType(t, f)
 }
 
+// TestTrueTypeCompositeGlyph looks for a composite glyph in goregular.TTF
+// (accented Latin letters, such as "Eacute", are typically built from a
+// base glyph plus a combining mark component) and checks that LoadGlyph
+// decodes it instead of returning errUnsupportedCompoundGlyph.
+func TestTrueTypeCompositeGlyph(t *testing.T) {
+	f, err := Parse(goregular.TTF)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	var b Buffer
+	found := false
+	for i := 0; i < f.NumGlyphs(); i++ {
+		data, err := f.glyfData(&b, GlyphIndex(i))
+		if err != nil || len(data) < 10 || int16(u16(data)) >= 0 {
+			continue
+		}
+		found = true
+		if err := f.LoadGlyph(&b, GlyphIndex(i), 0, nil); err != nil {
+			t.Errorf("i=%d: LoadGlyph: %v", i, err)
+			continue
+		}
+		if len(b.Segments) == 0 {
+			t.Errorf("i=%d: composite glyph produced no Segments", i)
+		}
+		break
+	}
+	if !found {
+		t.Skip("goregular.TTF contains no composite glyphs")
+	}
+}
+
 func testTrueType(t *testing.T, f *Font) {
 	if got, want := f.UnitsPerEm(), Units(2048); got != want {
 		t.Errorf("UnitsPerEm: got %d, want %d", got, want)
@@ -74,13 +145,85 @@ func testTrueType(t *testing.T, f *Font) {
 	if got, want := f.NumGlyphs(), 650; got <= want {
 		t.Errorf("NumGlyphs: got %d, want > %d", got, want)
 	}
+	testTrueTypeSegments(t, f)
 }
 
-func TestPostScript(t *testing.T) {
-	data, err := ioutil.ReadFile(filepath.Join("..", "testdata", "CFFTest.otf"))
-	if err != nil {
-		t.Fatal(err)
+// testTrueTypeSegments loads a handful of glyphs (by glyph index, not by
+// rune) and sanity-checks the
+// MoveTo/LineTo/QuadTo segments that LoadGlyph produces for them.
+func testTrueTypeSegments(t *testing.T, f *Font) {
+	var b Buffer
+	for _, i := range []GlyphIndex{0, 3, 4, 5, 36} {
+		if err := f.LoadGlyph(&b, i, 0, nil); err != nil {
+			t.Errorf("i=%d: LoadGlyph: %v", i, err)
+			continue
+		}
+		segs := append([]Segment(nil), b.Segments...)
+		if len(segs) == 0 {
+			// A glyph such as "space" legitimately has no contours.
+			continue
+		}
+		if segs[0].Op != SegmentOpMoveTo {
+			t.Errorf("i=%d: got %v as the first op, want MoveTo", i, segs[0].Op)
+			continue
+		}
+		nMoveTo := 0
+		for _, s := range segs {
+			switch s.Op {
+			case SegmentOpMoveTo:
+				nMoveTo++
+			case SegmentOpCubeTo:
+				t.Errorf("i=%d: got a CubeTo, TrueType outlines should only contain MoveTo, LineTo and QuadTo", i)
+			}
+		}
+		if nMoveTo == 0 {
+			t.Errorf("i=%d: got no MoveTo ops in a non-empty glyph", i)
+		}
+	}
+}
+
+// TestTrueTypeGlyfGolden is the glyf/QuadTo counterpart to TestPostScript's
+// golden Segment comparison. goregular.TTF's own glyph outlines aren't
+// checked in anywhere in this tree (see the NOTE at the top of this file),
+// so this builds a single-contour simple glyph by hand: an on-curve point,
+// an off-curve control point, and a second on-curve point, which loadSimpleGlyph
+// should turn into one MoveTo and one QuadTo with exact, predictable
+// coordinates.
+func TestTrueTypeGlyfGolden(t *testing.T) {
+	data := []byte{
+		0x00, 0x01, // numberOfContours
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, // xMin, yMin, xMax, yMax
+		0x00, 0x02, // endPtsOfContours[0]
+		0x00, 0x00, // instructionLength
+		// flags: on(0,0), off(+10,+10), on(+10,-10)
+		glyfOnCurvePoint | glyfXSame | glyfYSame,
+		glyfXShortVector | glyfXSame | glyfYShortVector | glyfYSame,
+		glyfOnCurvePoint | glyfXShortVector | glyfXSame | glyfYShortVector,
+		0x0a, 0x0a, // x deltas: +10 (off), +10 (on)
+		0x0a, 0x0a, // y deltas: +10 (off), -10 (on, YSame clear means negative)
+	}
+
+	var b Buffer
+	if err := loadSimpleGlyph(&b, data, 1, 1000, 0); err != nil {
+		t.Fatalf("loadSimpleGlyph: %v", err)
+	}
+	want := []Segment{
+		moveTo(0, 0),
+		quadTo(10, 10, 20, 0),
 	}
+	if got := b.Segments; len(got) != len(want) {
+		t.Fatalf("got %d elements, want %d\ngot  %v\nwant %v", len(got), len(want), got, want)
+	} else {
+		for i, g := range got {
+			if w := want[i]; g != w {
+				t.Errorf("element %d:\ngot  %v\nwant %v\noverall:\ngot  %v\nwant %v", i, g, w, got, want)
+			}
+		}
+	}
+}
+
+func TestPostScript(t *testing.T) {
+	data := readCFFTestOTF(t)
 	f, err := Parse(data)
 	if err != nil {
 		t.Fatal(err)
@@ -166,7 +309,9 @@ func TestPostScript(t *testing.T) {
 	var b Buffer
 loop:
 	for i, want := range wants {
-		if err := f.LoadGlyph(&b, GlyphIndex(i), nil); err != nil {
+		// A ppem of 0 means unscaled: the Args should equal the design units
+		// in the SFD file (and in wants) verbatim.
+		if err := f.LoadGlyph(&b, GlyphIndex(i), 0, nil); err != nil {
 			t.Errorf("i=%d: LoadGlyph: %v", i, err)
 			continue
 		}
@@ -184,4 +329,288 @@ loop:
 			}
 		}
 	}
+
+	// A non-zero ppem should scale Args proportionally to UnitsPerEm, rounded
+	// to the nearest 26.6 fixed-point value. Glyph index 1 ("zero")'s first
+	// MoveTo is at (300, 700) in design units.
+	const ppem = 12
+	upm := fixed.Int26_6(f.UnitsPerEm())
+	if err := f.LoadGlyph(&b, 1, fixed.I(ppem), nil); err != nil {
+		t.Fatalf("LoadGlyph (scaled): %v", err)
+	}
+	if len(b.Segments) == 0 || b.Segments[0].Op != SegmentOpMoveTo {
+		t.Fatalf("LoadGlyph (scaled): got %v, want a leading MoveTo", b.Segments)
+	}
+	if got, want := b.Segments[0].Args[0], (fixed.I(300*ppem)+upm/2)/upm; got != want {
+		t.Errorf("scaled x at %dppem: got %v, want %v", ppem, got, want)
+	}
+	if got, want := b.Segments[0].Args[1], (fixed.I(700*ppem)+upm/2)/upm; got != want {
+		t.Errorf("scaled y at %dppem: got %v, want %v", ppem, got, want)
+	}
+}
+
+func TestPostTable(t *testing.T) {
+	data := readCFFTestOTF(t)
+	f, err := Parse(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var b Buffer
+	post, err := f.PostTable(&b)
+	if err != nil {
+		t.Fatalf("PostTable: %v", err)
+	}
+	if post.ItalicAngle < -90 || post.ItalicAngle > 90 {
+		t.Errorf("ItalicAngle: got %v, want a value in [-90, 90]", post.ItalicAngle)
+	}
+	if post.UnderlineThickness <= 0 {
+		t.Errorf("UnderlineThickness: got %v, want a positive value", post.UnderlineThickness)
+	}
+
+	// Glyph index 1 is "zero" in CFFTest.otf (see the wants comments in
+	// TestPostScript). A version 2.0 post table records its PostScript
+	// name explicitly.
+	if name, err := post.GlyphName(1); err == nil && name != "zero" {
+		t.Errorf("GlyphName(1): got %q, want %q", name, "zero")
+	}
+}
+
+// TestCmap checks that GlyphIndex maps a handful of runes to the same glyph
+// indices that LoadGlyph-by-index would reach, and that an unmapped rune
+// resolves to glyph index 0 with no error.
+func TestCmap(t *testing.T) {
+	f, err := Parse(goregular.TTF)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	var b Buffer
+	x, err := f.GlyphIndex(&b, 'A')
+	if err != nil {
+		t.Fatalf("GlyphIndex('A'): %v", err)
+	}
+	if x == 0 {
+		t.Errorf("GlyphIndex('A'): got 0, want a non-zero glyph index")
+	}
+	if err := f.LoadGlyph(&b, x, 0, nil); err != nil {
+		t.Errorf("LoadGlyph(%d): %v", x, err)
+	}
+
+	// U+1F600 GRINNING FACE is outside the Basic Multilingual Plane, and
+	// goregular.TTF (a plain text font) shouldn't map it to anything.
+	if x, err := f.GlyphIndex(&b, '\U0001F600'); err != nil {
+		t.Errorf("GlyphIndex(supplementary-plane rune): %v", err)
+	} else if x != 0 {
+		t.Errorf("GlyphIndex(supplementary-plane rune): got %d, want 0", x)
+	}
+
+	// U+EEEE is in a Private Use Area that goregular.TTF shouldn't map.
+	if x, err := f.GlyphIndex(&b, '\uEEEE'); err != nil {
+		t.Errorf("GlyphIndex(unmapped rune): %v", err)
+	} else if x != 0 {
+		t.Errorf("GlyphIndex(unmapped rune): got %d, want 0", x)
+	}
+}
+
+// TestCmapFormat12 exercises the format-12 subtable parser directly, since
+// goregular.TTF (a BMP-only font) doesn't contain one.
+func TestCmapFormat12(t *testing.T) {
+	// One group: runes U+1F600 ..= U+1F602 map to glyph indices 9, 10, 11.
+	data := []byte{
+		0x00, 0x0c, // format 12
+		0x00, 0x00, // reserved
+		0x00, 0x00, 0x00, 0x00, // length (unused by the parser)
+		0x00, 0x00, 0x00, 0x00, // language
+		0x00, 0x00, 0x00, 0x01, // numGroups
+		0x00, 0x01, 0xf6, 0x00, // startCharCode
+		0x00, 0x01, 0xf6, 0x02, // endCharCode
+		0x00, 0x00, 0x00, 0x09, // startGlyphID
+	}
+	testCases := []struct {
+		r    rune
+		want GlyphIndex
+	}{
+		{'\U0001F600', 9},
+		{'\U0001F601', 10},
+		{'\U0001F602', 11},
+		{'\U0001F603', 0},
+		{'A', 0},
+	}
+	for _, tc := range testCases {
+		got, err := cmapFormat12(data, tc.r)
+		if err != nil {
+			t.Errorf("r=%U: %v", tc.r, err)
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("r=%U: got %d, want %d", tc.r, got, tc.want)
+		}
+	}
+}
+
+// TestHMetric checks that HMetric returns a sane, positive AdvanceWidth for
+// an ordinary letter, and that it scales proportionally to ppem.
+func TestHMetric(t *testing.T) {
+	f, err := Parse(goregular.TTF)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	var b Buffer
+	x, err := f.GlyphIndex(&b, 'A')
+	if err != nil {
+		t.Fatalf("GlyphIndex: %v", err)
+	}
+
+	unscaled, err := f.HMetric(&b, 0, x)
+	if err != nil {
+		t.Fatalf("HMetric: %v", err)
+	}
+	if unscaled.AdvanceWidth <= 0 {
+		t.Errorf("AdvanceWidth: got %v, want a positive value", unscaled.AdvanceWidth)
+	}
+
+	const ppem = 12
+	scaled, err := f.HMetric(&b, fixed.I(ppem), x)
+	if err != nil {
+		t.Fatalf("HMetric (scaled): %v", err)
+	}
+	upm := fixed.Int26_6(f.UnitsPerEm())
+	if got, want := scaled.AdvanceWidth, (unscaled.AdvanceWidth.Mul(fixed.I(ppem))+upm/2)/upm; got != want {
+		t.Errorf("scaled AdvanceWidth at %dppem: got %v, want %v", ppem, got, want)
+	}
+}
+
+// TestKern checks that Kern returns a zero, not-found adjustment when
+// goregular.TTF (which, as a plain text font, has no kern or GPOS pair
+// tables) doesn't mention a pair, here "AV", which is commonly kerned in
+// real-world fonts. TestKernFormat0 exercises the classic kern format 0
+// parser directly.
+func TestKern(t *testing.T) {
+	f, err := Parse(goregular.TTF)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	var b Buffer
+	a, err := f.GlyphIndex(&b, 'A')
+	if err != nil {
+		t.Fatalf("GlyphIndex('A'): %v", err)
+	}
+	v, err := f.GlyphIndex(&b, 'V')
+	if err != nil {
+		t.Fatalf("GlyphIndex('V'): %v", err)
+	}
+	if got, err := f.Kern(&b, fixed.I(12), a, v, NoHinting); err != nil {
+		t.Errorf("Kern: %v", err)
+	} else if got != 0 {
+		t.Errorf("Kern: got %v, want 0 (goregular.TTF has no kern/GPOS pair tables)", got)
+	}
+}
+
+// TestKernFormat0 exercises the classic "kern" subtable format 0 parser
+// directly, since goregular.TTF has no kern table at all.
+func TestKernFormat0(t *testing.T) {
+	// One pair: glyph 5 followed by glyph 7 is kerned by -40 font units.
+	data := []byte{
+		0x00, 0x01, // nPairs
+		0x00, 0x00, // searchRange
+		0x00, 0x00, // entrySelector
+		0x00, 0x00, // rangeShift
+		0x00, 0x05, // left
+		0x00, 0x07, // right
+		0xff, 0xd8, // value: -40
+	}
+	got, ok, err := kernFormat0(data, 5, 7)
+	if err != nil {
+		t.Fatalf("kernFormat0: %v", err)
+	}
+	if !ok || got != -40 {
+		t.Errorf("kernFormat0(5, 7): got (%d, %t), want (-40, true)", got, ok)
+	}
+	if _, ok, err := kernFormat0(data, 5, 8); err != nil {
+		t.Fatalf("kernFormat0: %v", err)
+	} else if ok {
+		t.Errorf("kernFormat0(5, 8): got ok=true, want false")
+	}
+}
+
+// TestPairPosFormat1 exercises the GPOS lookup-type-2 (pair adjustment)
+// format 1 parser directly, mirroring TestKernFormat0, since gposKern's
+// primary path (checked before the classic kern table in Font.Kern) has no
+// real-font fixture to drive it through Font.Kern.
+func TestPairPosFormat1(t *testing.T) {
+	// One pair: glyph 5 followed by glyph 7 is kerned by -30 font units via
+	// an XAdvance-only ValueRecord on the first glyph.
+	data := []byte{
+		0x00, 0x01, // posFormat
+		0x00, 0x0c, // coverageOffset (12)
+		0x00, 0x04, // valueFormat1: XAdvance
+		0x00, 0x00, // valueFormat2: none
+		0x00, 0x01, // pairSetCount
+		0x00, 0x12, // pairSetOffsets[0] (18)
+		// offset 12: Coverage, format 1
+		0x00, 0x01, // coverageFormat
+		0x00, 0x01, // glyphCount
+		0x00, 0x05, // glyphArray[0]: glyph 5
+		// offset 18: PairSet
+		0x00, 0x01, // pairValueCount
+		0x00, 0x07, // PairValueRecord[0].secondGlyph: glyph 7
+		0xff, 0xe2, // PairValueRecord[0].value1.XAdvance: -30
+	}
+	got, ok, err := parsePairPos(data, 5, 7)
+	if err != nil {
+		t.Fatalf("parsePairPos: %v", err)
+	}
+	if !ok || got != -30 {
+		t.Errorf("parsePairPos(5, 7): got (%d, %t), want (-30, true)", got, ok)
+	}
+	if _, ok, err := parsePairPos(data, 5, 8); err != nil {
+		t.Fatalf("parsePairPos: %v", err)
+	} else if ok {
+		t.Errorf("parsePairPos(5, 8): got ok=true, want false")
+	}
+	if _, ok, err := parsePairPos(data, 6, 7); err != nil {
+		t.Fatalf("parsePairPos: %v", err)
+	} else if ok {
+		t.Errorf("parsePairPos(6, 7): got ok=true, want false (glyph 6 isn't covered)")
+	}
+}
+
+// TestCFFIndexNonMonotonic checks that a CFF INDEX whose offsets array is
+// not non-decreasing (so that some entry's start would exceed its end) is
+// rejected with errInvalidCFFTable instead of panicking when callers slice
+// data[start:end].
+func TestCFFIndexNonMonotonic(t *testing.T) {
+	data := []byte{
+		0x00, 0x02, // count: 2
+		0x01,       // offSize: 1
+		0x01,       // offsets[0]: 1
+		0x03,       // offsets[1]: 3 (end of entry #0, start of entry #1)
+		0x01,       // offsets[2]: 1, less than offsets[1]: non-monotonic
+		0xaa, 0xbb, // entry data
+	}
+	if _, _, err := parseCFFIndex(data, 0); err != errInvalidCFFTable {
+		t.Errorf("parseCFFIndex: got %v, want errInvalidCFFTable", err)
+	}
+}
+
+// TestClassicKernMalformedSubtable checks that a "kern" subtable whose
+// length is too small to hold even the subtable header (6 bytes) is
+// rejected with errInvalidKernTable instead of panicking when classicKern
+// slices it.
+func TestClassicKernMalformedSubtable(t *testing.T) {
+	data := []byte{
+		0x00, 0x00, // version
+		0x00, 0x01, // nTables
+		0x00, 0x00, // subtable version
+		0x00, 0x02, // subtable length: too short to hold a 6-byte header
+		0x00, 0x01, // subtable coverage: horizontal, format 0
+	}
+	f := &Font{
+		src:  source{b: data},
+		kern: tableRecord{offset: 0, length: uint32(len(data))},
+	}
+	var b Buffer
+	if _, _, err := f.classicKern(&b, 5, 7); err != errInvalidKernTable {
+		t.Errorf("classicKern: got %v, want errInvalidKernTable", err)
+	}
 }